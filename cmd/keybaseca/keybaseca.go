@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -63,14 +64,35 @@ func main() {
 				if err != nil {
 					return err
 				}
-				bytes, err := ioutil.ReadFile(conf.GetCAKeyLocation())
-				if err != nil {
-					return fmt.Errorf("Failed to load the CA key from %s: %v", conf.GetCAKeyLocation(), err)
+
+				for _, team := range conf.GetTeams() {
+					teamConfig, err := conf.GetTeamConfig(team)
+					if err != nil {
+						return err
+					}
+
+					// Unwrap (and re-marshal) the key here purely to confirm that the configured
+					// passphrase/KMS key can actually decrypt it before we export something that might
+					// turn out to be unrecoverable
+					_, err = sshutils.LoadCAKey(context.Background(), teamConfig)
+					if err != nil {
+						return fmt.Errorf("Failed to load the CA key for team %s: %v", team, err)
+					}
+
+					bytes, err := ioutil.ReadFile(teamConfig.CAKeyLocation)
+					if err != nil {
+						return fmt.Errorf("Failed to load the CA key from %s: %v", teamConfig.CAKeyLocation, err)
+					}
+					if teamConfig.Encryption.Type == "" || teamConfig.Encryption.Type == "none" {
+						return fmt.Errorf("CA key for team %s is not encrypted at rest; configure encryption before running backup", team)
+					}
+
+					klog.Log(conf, klog.EventKeyExport, fmt.Sprintf("Exported encrypted CA key for team %s to stdout", team))
+					fmt.Printf("\nTeam %s (still encrypted, %s):\n\n", team, teamConfig.Encryption.Type)
+					fmt.Println(string(bytes))
 				}
-				klog.Log(conf, "Exported CA key to stdout")
-				fmt.Println("\nKeep this key somewhere very safe. We recommend keeping a physical copy of it in a secure place.")
-				fmt.Println("")
-				fmt.Println(string(bytes))
+
+				fmt.Println("Keep this output somewhere very safe. We recommend keeping a physical copy of it in a secure place.")
 				return nil
 			},
 		},
@@ -81,6 +103,14 @@ func main() {
 				cli.BoolFlag{
 					Name: "overwrite-existing-key",
 				},
+				cli.BoolFlag{
+					Name:  "encrypt",
+					Usage: "Encrypt the generated CA key at rest using the encryption settings in the config file",
+				},
+				cli.StringFlag{
+					Name:  "kms",
+					Usage: "Encrypt the generated CA key using a KMS key instead of a passphrase, eg --kms=aws://arn:aws:kms:... or --kms=gcp://projects/...",
+				},
 			},
 			Action: func(c *cli.Context) error {
 				conf, err := loadServerConfigAndWriteClientConfig(c.GlobalString("config"))
@@ -93,9 +123,90 @@ func main() {
 				if err != nil {
 					return fmt.Errorf("Failed to generate a new key: %v", err)
 				}
+
+				if c.Bool("encrypt") || c.String("kms") != "" {
+					kmsEncryption, err := parseKMSFlag(c.String("kms"))
+					if err != nil {
+						return fmt.Errorf("Invalid --kms: %v", err)
+					}
+
+					for _, team := range conf.GetTeams() {
+						teamConfig, err := conf.GetTeamConfig(team)
+						if err != nil {
+							return err
+						}
+						if kmsEncryption != nil {
+							teamConfig.Encryption = *kmsEncryption
+						}
+						err = sshutils.EncryptCAKeyInPlace(context.Background(), teamConfig, teamConfig.CAKeyLocation)
+						if err != nil {
+							return fmt.Errorf("Failed to encrypt the generated CA key for team %s: %v", team, err)
+						}
+
+						err = config.PersistEncryption(c.GlobalString("config"), team, teamConfig.Encryption)
+						if err != nil {
+							return fmt.Errorf("Encrypted the CA key for team %s but failed to save encryption.type "+
+								"back to the config file: %v. The key at %s is now ciphertext; you must manually "+
+								"add {\"encryption\": {\"type\": %q, \"key_source\": %q}} to its config entry before "+
+								"running keybaseca again", team, err, teamConfig.CAKeyLocation, teamConfig.Encryption.Type, teamConfig.Encryption.KeySource)
+						}
+					}
+				}
 				return nil
 			},
 		},
+		{
+			Name:  "host",
+			Usage: "Manage host certificate issuance",
+			Subcommands: []cli.Command{
+				{
+					Name:      "revoke",
+					Usage:     "Revoke a previously signed host key and republish the team's revocation list",
+					ArgsUsage: "TEAM HOST_PUBLIC_KEY",
+					Action: func(c *cli.Context) error {
+						if c.NArg() != 2 {
+							return fmt.Errorf("usage: keybaseca host revoke TEAM HOST_PUBLIC_KEY")
+						}
+						conf, err := loadServerConfig(c.GlobalString("config"))
+						if err != nil {
+							return err
+						}
+						team, hostKey := c.Args().Get(0), c.Args().Get(1)
+						err = bot.PublishRevocationList(conf, team, []string{hostKey})
+						if err != nil {
+							return fmt.Errorf("Failed to publish revocation list: %v", err)
+						}
+						klog.Log(conf, klog.EventConfigWrite, fmt.Sprintf("Republished host revocation list for team %s", team))
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:  "audit",
+			Usage: "Inspect the tamper-evident audit log",
+			Subcommands: []cli.Command{
+				{
+					Name:  "verify",
+					Usage: "Walk the audit log and report the first broken link in its hash chain, if any",
+					Action: func(c *cli.Context) error {
+						conf, err := loadServerConfig(c.GlobalString("config"))
+						if err != nil {
+							return err
+						}
+						brokenAt, err := klog.Verify(conf.GetLogLocation())
+						if err != nil {
+							return fmt.Errorf("Failed to verify audit log: %v", err)
+						}
+						if brokenAt == -1 {
+							fmt.Println("Audit log is intact: every record's hash chains correctly to the one before it.")
+							return nil
+						}
+						return fmt.Errorf("Audit log is broken: hash chain fails starting at line %d", brokenAt+1)
+					},
+				},
+			},
+		},
 		{
 			Name:  "service",
 			Usage: "Start the CA service in the foreground",
@@ -106,13 +217,50 @@ func main() {
 				}
 				captureControlCToDeleteClientConfig(conf)
 				defer deleteClientConfig(conf)
-				err = bot.StartBot(conf)
+				klog.Log(conf, klog.EventBotStart, "CA bot starting")
+				defer klog.Log(conf, klog.EventBotStop, "CA bot stopping")
+
+				socketPath := c.String("listen-socket")
+				if socketPath == "" {
+					socketPath = conf.GetListenSocketPath()
+				}
+				if socketPath != "" {
+					go func() {
+						err := bot.StartUnixSocketListener(conf, socketPath)
+						if err != nil {
+							log.Fatalf("unix socket signing listener crashed: %v", err)
+						}
+					}()
+				}
+
+				go bot.StartHostCertScheduler(conf)
+
+				// "host" is intentionally not auto-added here even when a team configures host cert issuance:
+				// like https and slack, it only runs when listed in --source, so that configuring host certs
+				// can't silently make an otherwise-working `service` invocation start failing
+				sources, err := bot.ParseSources(c.String("source"), conf)
 				if err != nil {
-					return fmt.Errorf("CA chatbot crashed: %v", err)
+					return fmt.Errorf("Invalid --source: %v", err)
+				}
+				err = bot.StartBot(conf, sources)
+				if err != nil {
+					return fmt.Errorf("CA bot crashed: %v", err)
 				}
 				return nil
 			},
-			Flags: []cli.Flag{},
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "source",
+					Value: "chat",
+					Usage: "Comma-separated list of acquisition sources to run concurrently: chat, https, slack. " +
+						"host is also accepted for teams with host cert issuance configured, but must be " +
+						"requested explicitly.",
+				},
+				cli.StringFlag{
+					Name:  "listen-socket",
+					Usage: "Also expose a local signing API over a UNIX socket at `PATH`, for co-located clients that use kssh --signer=unix://PATH",
+				},
+			},
 		},
 	}
 	app.Action = func(c *cli.Context) error {
@@ -178,7 +326,30 @@ func writeClientConfig(conf config.Config) error {
 	for _, team := range conf.GetTeams() {
 		filename := filepath.Join("/keybase/team/", team, shared.ConfigFilename)
 
-		content, err := json.Marshal(kssh.ConfigFile{TeamName: team, BotName: username, ChannelName: conf.GetChannelName()})
+		fingerprint, err := sshutils.GetCAKeyFingerprint(conf, team)
+		if err != nil {
+			return err
+		}
+
+		var hostCAPubKey string
+		teamConfig, err := conf.GetTeamConfig(team)
+		if err != nil {
+			return err
+		}
+		if teamConfig.Host.ServersTeam != "" {
+			hostCAPubKey, err = sshutils.GetCAPublicKey(conf, team)
+			if err != nil {
+				return err
+			}
+		}
+
+		content, err := json.Marshal(kssh.ConfigFile{
+			TeamName:        team,
+			BotName:         username,
+			ChannelName:     conf.GetChannelName(),
+			CAFingerprint:   fingerprint,
+			HostCAPublicKey: hostCAPubKey,
+		})
 		if err != nil {
 			return err
 		}
@@ -187,6 +358,7 @@ func writeClientConfig(conf config.Config) error {
 		if err != nil {
 			return err
 		}
+		klog.Log(conf, klog.EventConfigWrite, fmt.Sprintf("Wrote client config for team %s", team))
 	}
 
 	return nil
@@ -197,6 +369,7 @@ func writeClientConfig(conf config.Config) error {
 func deleteClientConfig(conf config.Config) error {
 	for _, team := range conf.GetTeams() {
 		filename := filepath.Join("/keybase/team/", team, shared.ConfigFilename)
+		klog.Log(conf, klog.EventConfigDelete, fmt.Sprintf("Deleting client config for team %s", team))
 		err := shared.KBFSDelete(filename)
 		if err != nil {
 			return err
@@ -220,6 +393,23 @@ func captureControlCToDeleteClientConfig(conf config.Config) {
 	}()
 }
 
+// parseKMSFlag parses a `--kms=` flag value, eg "aws://arn:aws:kms:...:key/abc" or "gcp://projects/...", into
+// an EncryptionConfig that overrides whatever's in the static config file for this `generate` invocation.
+// Returns (nil, nil) if flag is empty, meaning "use the config file's encryption settings as-is".
+func parseKMSFlag(flag string) (*config.EncryptionConfig, error) {
+	if flag == "" {
+		return nil, nil
+	}
+	switch {
+	case strings.HasPrefix(flag, "aws://"):
+		return &config.EncryptionConfig{Type: "kms-aws", KeySource: strings.TrimPrefix(flag, "aws://")}, nil
+	case strings.HasPrefix(flag, "gcp://"):
+		return &config.EncryptionConfig{Type: "kms-gcp", KeySource: strings.TrimPrefix(flag, "gcp://")}, nil
+	default:
+		return nil, fmt.Errorf("unsupported --kms scheme in %q, expected aws:// or gcp://", flag)
+	}
+}
+
 func loadServerConfig(configFilename string) (config.Config, error) {
 	if _, err := os.Stat(configFilename); os.IsNotExist(err) {
 		return nil, fmt.Errorf("Config file at %s does not exist", configFilename)
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/keybase/bot-ssh-ca/kssh"
+	"github.com/keybase/bot-ssh-ca/shared"
+
+	"github.com/urfave/cli"
+)
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "kssh"
+	app.Usage = "Requests a signed SSH cert from a keybaseca bot"
+	app.Version = "0.0.1"
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "team",
+			Usage: "Team to request a cert from (defaults to the team set via --set-default-team, or the only configured team)",
+		},
+		cli.StringFlag{
+			Name:  "signer",
+			Usage: "Signing backend to use, eg unix:///run/keybaseca/kssh.sock (required: this build has no Keybase chat signing)",
+		},
+		cli.StringFlag{
+			Name:  "principal",
+			Usage: "Principal to request on the signed cert",
+		},
+		cli.StringFlag{
+			Name:  "pubkey-file",
+			Usage: "Public key to sign (defaults to ~/.ssh/id_ed25519.pub)",
+		},
+		cli.StringFlag{
+			Name:  "validity",
+			Value: "+1h",
+			Usage: "Requested cert validity, as a ssh-keygen -V value",
+		},
+		cli.StringFlag{
+			Name:  "set-default-team",
+			Usage: "Persist TEAM as the default team for future kssh invocations and exit",
+		},
+		cli.StringFlag{
+			Name:  "install-known-hosts",
+			Usage: "Install a @cert-authority entry for HOST_PATTERN (eg '*.example.com') into ~/.ssh/known_hosts and exit",
+		},
+	}
+	app.Action = run
+
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintf(os.Stderr, "kssh: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(c *cli.Context) error {
+	if team := c.String("set-default-team"); team != "" {
+		return kssh.SetDefaultTeam(team)
+	}
+
+	cf, err := loadTeamConfig(c.String("team"))
+	if err != nil {
+		return err
+	}
+
+	if hostPattern := c.String("install-known-hosts"); hostPattern != "" {
+		return kssh.InstallKnownHosts(cf, hostPattern)
+	}
+
+	return signAndInstallCert(cf, c)
+}
+
+// loadTeamConfig resolves which team's ConfigFile to use: the explicit --team flag, the persisted default
+// team, or the lone configured team if there's only one, in that order.
+func loadTeamConfig(team string) (kssh.ConfigFile, error) {
+	configs, teams, err := kssh.LoadConfigs()
+	if err != nil {
+		return kssh.ConfigFile{}, err
+	}
+
+	if team == "" {
+		team, err = kssh.GetDefaultTeam()
+		if err != nil {
+			return kssh.ConfigFile{}, err
+		}
+	}
+	if team == "" && len(teams) == 1 {
+		team = teams[0]
+	}
+	if team == "" {
+		return kssh.ConfigFile{}, fmt.Errorf("you are in multiple teams running keybaseca, pass --team or run --set-default-team")
+	}
+
+	for _, cf := range configs {
+		if cf.TeamName == team {
+			return cf, nil
+		}
+	}
+	return kssh.ConfigFile{}, fmt.Errorf("no keybaseca config found for team %s", team)
+}
+
+// signAndInstallCert signs --pubkey-file through the configured Signer, pins the result against cf's CA
+// fingerprint, and writes the signed cert alongside the pubkey file so that ssh picks it up automatically.
+func signAndInstallCert(cf kssh.ConfigFile, c *cli.Context) error {
+	signer, err := kssh.ParseSignerFlag(c.String("signer"))
+	if err != nil {
+		return err
+	}
+	if signer == nil {
+		return fmt.Errorf("no --signer configured and Keybase chat signing isn't supported by this build; pass --signer=unix://...")
+	}
+
+	principal := c.String("principal")
+	if principal == "" {
+		return fmt.Errorf("--principal is required")
+	}
+
+	pubKeyPath := c.String("pubkey-file")
+	if pubKeyPath == "" {
+		pubKeyPath = shared.ExpandPathWithTilde("~/.ssh/id_ed25519.pub")
+	}
+	pubKey, err := ioutil.ReadFile(pubKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read public key at %s: %v", pubKeyPath, err)
+	}
+
+	cert, err := signer.Sign(cf.TeamName, []string{principal}, c.String("validity"), string(pubKey))
+	if err != nil {
+		return fmt.Errorf("failed to sign cert: %v", err)
+	}
+
+	fingerprint, err := signingCAFingerprint(cert)
+	if err != nil {
+		return err
+	}
+	if err := cf.VerifyCAFingerprint(fingerprint); err != nil {
+		return err
+	}
+
+	certPath := strings.TrimSuffix(pubKeyPath, ".pub") + "-cert.pub"
+	if err := ioutil.WriteFile(certPath, []byte(cert), 0600); err != nil {
+		return fmt.Errorf("failed to write signed cert to %s: %v", certPath, err)
+	}
+	fmt.Printf("Wrote signed cert to %s\n", certPath)
+	return nil
+}
+
+// signingCAFingerprint shells out to `ssh-keygen -Lf` to pull the signing CA's fingerprint out of a freshly
+// signed cert, so it can be checked against the fingerprint pinned in the team's ConfigFile before the cert
+// is trusted.
+func signingCAFingerprint(cert string) (string, error) {
+	f, err := ioutil.TempFile("", "kssh-cert-*.pub")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(cert); err != nil {
+		f.Close()
+		return "", err
+	}
+	f.Close()
+
+	output, err := exec.Command("ssh-keygen", "-Lf", f.Name()).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect signed cert: %v: %s", err, string(output))
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Signing CA: ") {
+			for _, field := range strings.Fields(line) {
+				if strings.HasPrefix(field, "SHA256:") {
+					return field, nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("could not find signing CA fingerprint in ssh-keygen -Lf output")
+}
@@ -0,0 +1,21 @@
+// Package bot implements the CA's signing logic and its acquisition sources: Keybase chat, an HTTPS
+// webhook, and a Slack bot. Every source applies the policy configured for the requesting team and signs
+// certs with the appropriate team's CA key.
+package bot
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/keybase/bot-ssh-ca/keybaseca/config"
+)
+
+// GetUsername returns the Keybase username that the running bot is authenticated as
+func GetUsername(conf config.Config) (string, error) {
+	cmd := exec.Command("keybase", "whoami")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,27 @@
+package bot
+
+import (
+	"fmt"
+
+	"github.com/keybase/bot-ssh-ca/keybaseca/config"
+)
+
+// chatListener is the "chat" RequestSource, for signing requests sent as messages in the configured Keybase
+// chat channel. This build has no chat subscription loop, so it handles no requests (see Start).
+type chatListener struct {
+	conf config.Config
+}
+
+func newChatListener(conf config.Config) (*chatListener, error) {
+	return &chatListener{conf: conf}, nil
+}
+
+func (c *chatListener) Name() string {
+	return "chat"
+}
+
+func (c *chatListener) Start(conf config.Config) error {
+	// Returns an error straight away without reading any messages: the Keybase chat subscription loop is not
+	// part of this build, so no chat request ever reaches signPubKey.
+	return fmt.Errorf("chat listener not implemented in this build")
+}
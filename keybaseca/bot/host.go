@@ -0,0 +1,144 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/keybase/bot-ssh-ca/keybaseca/config"
+	klog "github.com/keybase/bot-ssh-ca/keybaseca/log"
+	"github.com/keybase/bot-ssh-ca/keybaseca/sshutils"
+)
+
+// hostCertRenewalInterval is how often the scheduler checks for host certs that need re-signing. Host certs
+// are intentionally short-lived, so this runs much more often than anything on the user-cert path.
+const hostCertRenewalInterval = 15 * time.Minute
+
+// HostCertRequest is sent by a server (proving membership in its team's Host.ServersTeam) asking the bot to
+// sign its host key
+type HostCertRequest struct {
+	Team     string
+	Hostname string
+	HostKey  string
+}
+
+// signHostCert signs req.HostKey as a host cert for req.Hostname, scoped to the validity configured for
+// req.Team, and records the result in the audit log
+func signHostCert(conf config.Config, req HostCertRequest) (cert []byte, err error) {
+	teamConfig, err := conf.GetTeamConfig(req.Team)
+	if err != nil {
+		return nil, err
+	}
+	if teamConfig.Host.ServersTeam == "" {
+		return nil, fmt.Errorf("team %s is not configured to issue host certs", req.Team)
+	}
+
+	keyLocation, cleanupKey, err := sshutils.PrepareSigningKey(context.Background(), teamConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupKey()
+
+	validity := teamConfig.Host.CertValidity
+	if validity == "" {
+		validity = "+6h"
+	}
+
+	hostKeyFile, err := writeTempPubKey(req.HostKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("ssh-keygen",
+		"-s", keyLocation,
+		"-h",
+		"-I", req.Hostname,
+		"-n", req.Hostname,
+		"-V", validity,
+		hostKeyFile,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign host cert for %s: %v: %s", req.Hostname, err, string(output))
+	}
+
+	cert, err = readSignedCert(hostKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	err = klog.Log(conf, klog.EventSignRequest, fmt.Sprintf("Signed host cert for %s (team %s)", req.Hostname, req.Team))
+	if err != nil {
+		return nil, err
+	}
+
+	hostCertRegistry.remember(req, validity)
+	return cert, nil
+}
+
+// hostCertEntry is what the scheduler needs to re-sign a previously issued host cert before it expires
+type hostCertEntry struct {
+	req       HostCertRequest
+	expiresAt time.Time
+}
+
+type hostCertStore struct {
+	mu      sync.Mutex
+	entries map[string]hostCertEntry
+}
+
+var hostCertRegistry = &hostCertStore{entries: make(map[string]hostCertEntry)}
+
+func (s *hostCertStore) remember(req HostCertRequest, validity string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[req.Hostname] = hostCertEntry{req: req, expiresAt: validityDeadline(validity)}
+}
+
+func (s *hostCertStore) dueForRenewal(within time.Duration) []HostCertRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []HostCertRequest
+	for _, entry := range s.entries {
+		if time.Until(entry.expiresAt) < within {
+			due = append(due, entry.req)
+		}
+	}
+	return due
+}
+
+// validityDeadline makes a best-effort estimate of when a ssh-keygen -V "+Nh"-style validity string expires,
+// measured from now. Used only to schedule proactive re-signing, never to enforce the cert's actual
+// validity window, which sshd derives directly from the cert itself.
+func validityDeadline(validity string) time.Time {
+	duration, err := time.ParseDuration(toGoDuration(validity))
+	if err != nil {
+		return time.Now().Add(hostCertRenewalInterval)
+	}
+	return time.Now().Add(duration)
+}
+
+func toGoDuration(validity string) string {
+	// ssh-keygen -V validity strings look like "+6h" or "+30m"; Go's time.ParseDuration understands the same
+	// suffixes once the leading '+' is stripped
+	if len(validity) > 0 && validity[0] == '+' {
+		return validity[1:]
+	}
+	return validity
+}
+
+// StartHostCertScheduler runs until ctx-like shutdown (the process exiting), periodically re-signing host
+// certs that are close to expiring so that servers never end up holding an expired cert
+func StartHostCertScheduler(conf config.Config) {
+	ticker := time.NewTicker(hostCertRenewalInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, req := range hostCertRegistry.dueForRenewal(hostCertRenewalInterval) {
+			if _, err := signHostCert(conf, req); err != nil {
+				klog.Log(conf, klog.EventSignRequest, fmt.Sprintf("Failed to renew host cert for %s: %v", req.Hostname, err))
+			}
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package bot
+
+import (
+	"fmt"
+
+	"github.com/keybase/bot-ssh-ca/keybaseca/config"
+)
+
+// hostChatListener is the "host" RequestSource, for HostCertRequests sent as messages in a team's
+// Host.ServersTeam channel, where membership in that team is what proves a server's identity to the bot.
+// This build has no chat subscription loop, so it issues no host certs (see Start). StartHostCertScheduler
+// only ever re-signs certs that signHostCert has already issued, so it has nothing to renew either.
+type hostChatListener struct {
+	conf config.Config
+}
+
+func newHostChatListener(conf config.Config) (*hostChatListener, error) {
+	return &hostChatListener{conf: conf}, nil
+}
+
+func (h *hostChatListener) Name() string {
+	return "host"
+}
+
+func (h *hostChatListener) Start(conf config.Config) error {
+	// Returns an error straight away without reading any host cert requests: the Keybase chat subscription
+	// loop is not part of this build, same as chatListener, so no request ever reaches signHostCert.
+	return fmt.Errorf("host chat listener not implemented in this build")
+}
@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/keybase/bot-ssh-ca/keybaseca/config"
+)
+
+// httpsRequestBody is the JSON body a webhook caller posts to request a signature. The caller's identity
+// comes entirely from its mTLS client certificate's CommonName, which must be mapped to a Keybase username
+// in the same config.Config used by the other sources.
+type httpsRequestBody struct {
+	Team       string   `json:"team"`
+	Principals []string `json:"principals"`
+	PubKey     string   `json:"pub_key"`
+}
+
+type httpsResponseBody struct {
+	Cert  string `json:"cert,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// httpsSource receives signing requests as JSON POSTs over an HTTPS listener that requires client
+// certificates (mTLS), so that the webhook endpoint can be safely exposed beyond localhost
+type httpsSource struct {
+	conf config.Config
+}
+
+func newHTTPSSource(conf config.Config) *httpsSource {
+	return &httpsSource{conf: conf}
+}
+
+func (h *httpsSource) Name() string {
+	return "https"
+}
+
+func (h *httpsSource) Start(conf config.Config) error {
+	listenAddr := conf.GetHTTPSListenAddr()
+	if listenAddr == "" {
+		return fmt.Errorf("https source selected but no https_source.listen_addr configured")
+	}
+
+	certPool := x509.NewCertPool()
+	caCertPEM, err := ioutil.ReadFile(conf.GetHTTPSClientCAPath())
+	if err != nil {
+		return fmt.Errorf("failed to read https client CA: %v", err)
+	}
+	if !certPool.AppendCertsFromPEM(caCertPEM) {
+		return fmt.Errorf("failed to parse https client CA at %s", conf.GetHTTPSClientCAPath())
+	}
+
+	server := &http.Server{
+		Addr: listenAddr,
+		TLSConfig: &tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  certPool,
+		},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.handleRequest(conf, w, r)
+		}),
+	}
+
+	return server.ListenAndServeTLS(conf.GetHTTPSServerCertPath(), conf.GetHTTPSServerKeyPath())
+}
+
+func (h *httpsSource) handleRequest(conf config.Config, w http.ResponseWriter, r *http.Request) {
+	if len(r.TLS.PeerCertificates) == 0 {
+		writeHTTPSError(w, fmt.Errorf("no client certificate presented"))
+		return
+	}
+	var body httpsRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeHTTPSError(w, fmt.Errorf("failed to decode request: %v", err))
+		return
+	}
+
+	// Authenticating the client cert against body.Team (not just a global CommonName->username mapping) is
+	// what stops a cert entitled to sign for one team from requesting certs against another team's CA and
+	// policy
+	username, err := conf.GetKeybaseUsernameForCommonName(r.TLS.PeerCertificates[0].Subject.CommonName, body.Team)
+	if err != nil {
+		writeHTTPSError(w, err)
+		return
+	}
+
+	cert, err := signPubKey(conf, signingRequest{
+		Team:       body.Team,
+		Username:   username,
+		Principals: body.Principals,
+		PubKey:     body.PubKey,
+	})
+	if err != nil {
+		writeHTTPSError(w, err)
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(httpsResponseBody{Cert: string(cert)})
+}
+
+func writeHTTPSError(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusForbidden)
+	_ = json.NewEncoder(w).Encode(httpsResponseBody{Error: err.Error()})
+}
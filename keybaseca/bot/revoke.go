@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/keybase/bot-ssh-ca/keybaseca/config"
+	"github.com/keybase/bot-ssh-ca/shared"
+)
+
+// PublishRevocationList merges newlyRevokedHostKeys into the full set of host keys ever revoked for team
+// (persisted alongside the KRL, since `ssh-keygen -k` has no notion of appending to an existing KRL), then
+// regenerates the KRL (see ssh-keygen -k) from that full set and publishes it to the team's configured
+// RevocationListPath in KBFS, where sshd can consume it directly via `RevokedKeys
+// /keybase/team/.../revoked-hosts.krl`.
+func PublishRevocationList(conf config.Config, team string, newlyRevokedHostKeys []string) error {
+	teamConfig, err := conf.GetTeamConfig(team)
+	if err != nil {
+		return err
+	}
+	if teamConfig.Host.RevocationListPath == "" {
+		return fmt.Errorf("team %s has no host.revocation_list_path configured", team)
+	}
+
+	revokedKeysPath := teamConfig.Host.RevocationListPath + ".keys"
+	revokedHostKeys, err := mergeRevokedKeys(revokedKeysPath, newlyRevokedHostKeys)
+	if err != nil {
+		return err
+	}
+
+	keysFile, err := ioutil.TempFile("", "keybaseca-revoked-*.pub")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(keysFile.Name())
+	for _, key := range revokedHostKeys {
+		if _, err := keysFile.WriteString(key + "\n"); err != nil {
+			return err
+		}
+	}
+	keysFile.Close()
+
+	krlFile, err := ioutil.TempFile("", "keybaseca-revoked-*.krl")
+	if err != nil {
+		return err
+	}
+	krlFile.Close()
+	defer os.Remove(krlFile.Name())
+
+	cmd := exec.Command("ssh-keygen", "-k", "-f", krlFile.Name(), keysFile.Name())
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to generate revocation list: %v: %s", err, string(output))
+	}
+
+	krlBytes, err := ioutil.ReadFile(krlFile.Name())
+	if err != nil {
+		return err
+	}
+
+	if err := shared.KBFSWrite(revokedKeysPath, strings.Join(revokedHostKeys, "\n")+"\n", true); err != nil {
+		return fmt.Errorf("failed to persist merged revoked key list: %v", err)
+	}
+
+	return shared.KBFSWrite(teamConfig.Host.RevocationListPath, string(krlBytes), true)
+}
+
+// mergeRevokedKeys reads the full set of host keys ever revoked for a team from path (if it exists yet) and
+// returns it merged with newlyRevoked, deduplicated and order-preserving. Every call to PublishRevocationList
+// must regenerate the KRL from this full set, not just the keys it was passed, or each call would silently
+// un-revoke everything revoked by a previous call.
+func mergeRevokedKeys(path string, newlyRevoked []string) ([]string, error) {
+	exists, err := shared.KBFSFileExists(path)
+	if err != nil {
+		return nil, err
+	}
+	var existing []string
+	if exists {
+		bytes, err := shared.KBFSRead(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read existing revoked key list: %v", err)
+		}
+		for _, line := range strings.Split(string(bytes), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				existing = append(existing, line)
+			}
+		}
+	}
+
+	return dedupeRevokedKeys(existing, newlyRevoked), nil
+}
+
+// dedupeRevokedKeys merges existing and newlyRevoked, preserving order and dropping duplicates, so that
+// re-revoking an already-revoked key is a no-op rather than a duplicate KRL entry
+func dedupeRevokedKeys(existing, newlyRevoked []string) []string {
+	seen := make(map[string]bool, len(existing)+len(newlyRevoked))
+	merged := make([]string, 0, len(existing)+len(newlyRevoked))
+	for _, key := range append(existing, newlyRevoked...) {
+		if !seen[key] {
+			seen[key] = true
+			merged = append(merged, key)
+		}
+	}
+	return merged
+}
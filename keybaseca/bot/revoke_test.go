@@ -0,0 +1,22 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDedupeRevokedKeysDropsDuplicates(t *testing.T) {
+	got := dedupeRevokedKeys([]string{"key-a", "key-b"}, []string{"key-b", "key-c"})
+	want := []string{"key-a", "key-b", "key-c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestDedupeRevokedKeysNoExisting(t *testing.T) {
+	got := dedupeRevokedKeys(nil, []string{"key-a", "key-a"})
+	want := []string{"key-a"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
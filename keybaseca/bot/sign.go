@@ -0,0 +1,171 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/keybase/bot-ssh-ca/keybaseca/config"
+	klog "github.com/keybase/bot-ssh-ca/keybaseca/log"
+	"github.com/keybase/bot-ssh-ca/keybaseca/sshutils"
+)
+
+// signingRequest is the payload sent by a client (Keybase chat or a unix socket client) asking the bot to
+// sign a pubkey on behalf of a Keybase user
+type signingRequest struct {
+	Team       string
+	Username   string
+	Principals []string
+	PubKey     string
+}
+
+// signPubKey applies the policy configured for req.Team and, if the request is allowed, signs req.PubKey
+// with that team's CA key. Every acquisition source (chat, unix socket, ...) must route through this
+// function so that policy is enforced identically regardless of how the request arrived.
+func signPubKey(conf config.Config, req signingRequest) (cert []byte, err error) {
+	teamConfig, err := conf.GetTeamConfig(req.Team)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(req.Principals) == 0 {
+		// ssh-keygen -s treats a cert with no principals (`-n ""`) as valid for ANY principal, so an empty
+		// list must be rejected outright rather than vacuously passing the loop below
+		return nil, fmt.Errorf("user %s requested a cert with no principals", req.Username)
+	}
+	for _, principal := range req.Principals {
+		if !contains(teamConfig.AllowedPrincipals, principal) {
+			return nil, fmt.Errorf("user %s is not allowed to request principal %s for team %s", req.Username, principal, req.Team)
+		}
+	}
+
+	keyLocation, cleanupKey, err := sshutils.PrepareSigningKey(context.Background(), teamConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupKey()
+
+	validity := teamConfig.MaxCertValidity
+	if validity == "" {
+		validity = "+1h"
+	}
+
+	pubKeyFile, err := writeTempPubKey(req.PubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"-s", keyLocation,
+		"-I", req.Username,
+		"-n", strings.Join(req.Principals, ","),
+		"-V", validity,
+	}
+	for _, opt := range certOptions(teamConfig) {
+		args = append(args, "-O", opt)
+	}
+	args = append(args, pubKeyFile)
+	cmd := exec.Command("ssh-keygen", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign cert for %s: %v: %s", req.Username, err, string(output))
+	}
+
+	cert, err = readSignedCert(pubKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := certSerial(cert)
+	if err != nil {
+		return nil, err
+	}
+	err = klog.LogRecord(conf, klog.Record{
+		EventType:           klog.EventSignRequest,
+		ActorUsername:       req.Username,
+		Team:                req.Team,
+		RequestedPrincipals: req.Principals,
+		GrantedPrincipals:   req.Principals,
+		CertSerial:          serial,
+		CertValidityWindow:  validity,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("signed a cert for %s but failed to write it to the audit log: %v", req.Username, err)
+	}
+
+	return cert, nil
+}
+
+// certOptions builds the `-O` certificate options (see ssh-keygen(1)) that embed teamConfig's restrictions
+// into every cert issued for the team. AllowedSourceAddresses becomes a single source-address extension
+// restricting the cert to that address list; AllowedForceCommands, if configured, force-commands the cert to
+// its first (and today, only supported) entry.
+func certOptions(teamConfig config.TeamConfig) []string {
+	var opts []string
+	if len(teamConfig.AllowedSourceAddresses) > 0 {
+		opts = append(opts, "source-address="+strings.Join(teamConfig.AllowedSourceAddresses, ","))
+	}
+	if len(teamConfig.AllowedForceCommands) > 0 {
+		opts = append(opts, "force-command="+teamConfig.AllowedForceCommands[0])
+	}
+	return opts
+}
+
+// certSerial shells out to ssh-keygen -Lf to pull the serial number out of a freshly signed cert, for
+// inclusion in the audit log
+func certSerial(cert []byte) (string, error) {
+	certFile, err := writeTempPubKey(string(cert))
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(certFile)
+
+	output, err := exec.Command("ssh-keygen", "-Lf", certFile).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect signed cert: %v: %s", err, string(output))
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Serial: ") {
+			return strings.TrimPrefix(line, "Serial: "), nil
+		}
+	}
+	return "", fmt.Errorf("could not find serial number in ssh-keygen -Lf output")
+}
+
+// writeTempPubKey writes the given public key to a temp file so that it can be passed to ssh-keygen -s,
+// which only operates on files. Returns the path to the written file.
+func writeTempPubKey(pubKey string) (string, error) {
+	f, err := ioutil.TempFile("", "keybaseca-pubkey-*.pub")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(pubKey); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// readSignedCert reads back the -cert.pub file that ssh-keygen -s writes alongside pubKeyFile, and cleans
+// up both temp files
+func readSignedCert(pubKeyFile string) ([]byte, error) {
+	defer os.Remove(pubKeyFile)
+	certFile := strings.TrimSuffix(pubKeyFile, ".pub") + "-cert.pub"
+	defer os.Remove(certFile)
+	return ioutil.ReadFile(certFile)
+}
+
+// contains reports whether item is in list, or list allows any item via config.AllowAnyPrincipal (as
+// populated by GetTeamConfig's legacy single-CA fallback, which has no way to express a restricted list)
+func contains(list []string, item string) bool {
+	for _, s := range list {
+		if s == item || s == config.AllowAnyPrincipal {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/keybase/bot-ssh-ca/keybaseca/config"
+)
+
+// fakeConfig is a minimal config.Config for tests that only exercise the policy checks at the top of
+// signPubKey, which return before any method other than GetTeamConfig is called.
+type fakeConfig struct {
+	teamConfig config.TeamConfig
+}
+
+func (f *fakeConfig) GetCAKeyLocation() string                       { return "" }
+func (f *fakeConfig) GetCAKeyLocationForTeam(string) (string, error) { return "", nil }
+func (f *fakeConfig) GetTeamConfig(string) (config.TeamConfig, error) {
+	return f.teamConfig, nil
+}
+func (f *fakeConfig) GetTeams() []string                                      { return nil }
+func (f *fakeConfig) GetChannelName() string                                  { return "" }
+func (f *fakeConfig) GetKeybaseHomeDir() string                               { return "" }
+func (f *fakeConfig) GetLogLocation() string                                  { return "" }
+func (f *fakeConfig) GetKeybaseUsernameForUID(string, string) (string, error) { return "", nil }
+func (f *fakeConfig) GetListenSocketPath() string                             { return "" }
+func (f *fakeConfig) GetHTTPSListenAddr() string                              { return "" }
+func (f *fakeConfig) GetHTTPSClientCAPath() string                            { return "" }
+func (f *fakeConfig) GetHTTPSServerCertPath() string                          { return "" }
+func (f *fakeConfig) GetHTTPSServerKeyPath() string                           { return "" }
+func (f *fakeConfig) GetKeybaseUsernameForCommonName(string, string) (string, error) {
+	return "", nil
+}
+func (f *fakeConfig) GetSlackListenAddr() string      { return "" }
+func (f *fakeConfig) GetSlackUserMappingPath() string { return "" }
+func (f *fakeConfig) GetSlackSigningSecret() string   { return "" }
+
+func TestContains(t *testing.T) {
+	if !contains([]string{"ubuntu", "ec2-user"}, "ubuntu") {
+		t.Error("expected ubuntu to be allowed")
+	}
+	if contains([]string{"ubuntu"}, "root") {
+		t.Error("expected root to not be allowed")
+	}
+	if !contains([]string{config.AllowAnyPrincipal}, "anything") {
+		t.Error("expected the wildcard entry to allow any principal")
+	}
+}
+
+func TestSignPubKeyRejectsEmptyPrincipals(t *testing.T) {
+	conf := &fakeConfig{teamConfig: config.TeamConfig{AllowedPrincipals: []string{"ubuntu"}}}
+	_, err := signPubKey(conf, signingRequest{Team: "acme", Username: "alice", Principals: nil, PubKey: "ssh-ed25519 AAAA"})
+	if err == nil {
+		t.Fatal("expected an error for a request with no principals")
+	}
+}
+
+func TestSignPubKeyRejectsDisallowedPrincipal(t *testing.T) {
+	conf := &fakeConfig{teamConfig: config.TeamConfig{AllowedPrincipals: []string{"ubuntu"}}}
+	_, err := signPubKey(conf, signingRequest{Team: "acme", Username: "alice", Principals: []string{"root"}, PubKey: "ssh-ed25519 AAAA"})
+	if err == nil {
+		t.Fatal("expected an error for a disallowed principal")
+	}
+}
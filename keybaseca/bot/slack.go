@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keybase/bot-ssh-ca/keybaseca/config"
+)
+
+// slackTimestampTolerance is how far a request's X-Slack-Request-Timestamp is allowed to drift from now
+// before it's rejected, guarding against replay of an old, previously-valid signed request
+const slackTimestampTolerance = 5 * time.Minute
+
+// slackSource receives signing requests as Slack slash commands. A requester's Slack identity is mapped to
+// a Keybase username via a configured JSON mapping file (slack user ID -> Keybase username), since Slack has
+// no notion of a Keybase identity on its own.
+type slackSource struct {
+	conf           config.Config
+	slackToKeybase map[string]string
+}
+
+func newSlackSource(conf config.Config) (*slackSource, error) {
+	mappingPath := conf.GetSlackUserMappingPath()
+	if mappingPath == "" {
+		return nil, fmt.Errorf("slack source selected but no slack_source.user_mapping_path configured")
+	}
+	if conf.GetSlackSigningSecret() == "" {
+		return nil, fmt.Errorf("slack source selected but no slack_source.signing_secret configured")
+	}
+
+	bytes, err := ioutil.ReadFile(mappingPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read slack user mapping at %s: %v", mappingPath, err)
+	}
+	var mapping map[string]string
+	if err := json.Unmarshal(bytes, &mapping); err != nil {
+		return nil, fmt.Errorf("failed to parse slack user mapping: %v", err)
+	}
+
+	return &slackSource{conf: conf, slackToKeybase: mapping}, nil
+}
+
+func (s *slackSource) Name() string {
+	return "slack"
+}
+
+func (s *slackSource) Start(conf config.Config) error {
+	listenAddr := conf.GetSlackListenAddr()
+	if listenAddr == "" {
+		return fmt.Errorf("slack source selected but no slack_source.listen_addr configured")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slack/sign", func(w http.ResponseWriter, r *http.Request) {
+		s.handleSlashCommand(conf, w, r)
+	})
+	return http.ListenAndServe(listenAddr, mux)
+}
+
+// handleSlashCommand handles a Slack slash command of the form `/sshsign <team> <principal> <pubkey>`
+func (s *slackSource) handleSlashCommand(conf config.Config, w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeSlackError(w, fmt.Errorf("failed to read request body: %v", err))
+		return
+	}
+
+	if err := verifySlackSignature(conf.GetSlackSigningSecret(), r.Header, body); err != nil {
+		writeSlackError(w, err)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeSlackError(w, fmt.Errorf("failed to parse slash command: %v", err))
+		return
+	}
+
+	slackUserID := form.Get("user_id")
+	username, ok := s.slackToKeybase[slackUserID]
+	if !ok {
+		writeSlackError(w, fmt.Errorf("Slack user %s has no configured Keybase identity", slackUserID))
+		return
+	}
+
+	args := strings.Fields(form.Get("text"))
+	if len(args) < 3 {
+		writeSlackError(w, fmt.Errorf("usage: /sshsign <team> <principal> <pubkey>"))
+		return
+	}
+	team, principal, pubKey := args[0], args[1], strings.Join(args[2:], " ")
+
+	cert, err := signPubKey(conf, signingRequest{
+		Team:       team,
+		Username:   username,
+		Principals: []string{principal},
+		PubKey:     pubKey,
+	})
+	if err != nil {
+		writeSlackError(w, err)
+		return
+	}
+
+	writeSlackText(w, fmt.Sprintf("Signed cert for %s:\n```\n%s\n```", username, string(cert)))
+}
+
+// verifySlackSignature implements Slack's request signing verification: https://api.slack.com/authentication/verifying-requests-from-slack
+func verifySlackSignature(signingSecret string, header http.Header, body []byte) error {
+	timestampHeader := header.Get("X-Slack-Request-Timestamp")
+	timestamp, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid X-Slack-Request-Timestamp")
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age > slackTimestampTolerance || age < -slackTimestampTolerance {
+		return fmt.Errorf("X-Slack-Request-Timestamp is too far from the current time, possible replay")
+	}
+
+	baseString := fmt.Sprintf("v0:%s:%s", timestampHeader, string(body))
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte(baseString))
+	expectedSignature := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	presentedSignature := header.Get("X-Slack-Signature")
+	if !hmac.Equal([]byte(expectedSignature), []byte(presentedSignature)) {
+		return fmt.Errorf("invalid X-Slack-Signature")
+	}
+	return nil
+}
+
+func writeSlackError(w http.ResponseWriter, err error) {
+	writeSlackText(w, fmt.Sprintf("Failed to sign: %v", err))
+}
+
+func writeSlackText(w http.ResponseWriter, text string) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"response_type": "ephemeral", "text": text})
+}
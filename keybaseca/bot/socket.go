@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/keybase/bot-ssh-ca/keybaseca/config"
+	"golang.org/x/sys/unix"
+)
+
+// SocketSigningRequest is the wire format sent by a kssh `--signer=unix://...` client
+type SocketSigningRequest struct {
+	Team       string   `json:"team"`
+	Principals []string `json:"principals"`
+	Validity   string   `json:"validity"`
+	PubKey     string   `json:"pub_key"`
+}
+
+// SocketSigningResponse is the wire format returned to a kssh `--signer=unix://...` client
+type SocketSigningResponse struct {
+	Cert  string `json:"cert,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// StartUnixSocketListener listens for signing requests on a local UNIX socket. This exists so that
+// co-located clients (build fleets, CI runners) can get a cert signed without paying the latency of a
+// Keybase chat/KBFS round trip. Peers are authenticated via SO_PEERCRED: the connecting process's uid is
+// looked up in conf's uid-to-Keybase-username mapping, and the resulting username is subject to the exact
+// same policy checks as the chat path.
+func StartUnixSocketListener(conf config.Config, socketPath string) error {
+	_ = unix.Unlink(socketPath)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", socketPath, err)
+	}
+	defer listener.Close()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return fmt.Errorf("unix socket listener crashed: %v", err)
+		}
+		go handleSocketConn(conf, conn)
+	}
+}
+
+func handleSocketConn(conf config.Config, conn net.Conn) {
+	defer conn.Close()
+
+	uid, err := peerUID(conn)
+	if err != nil {
+		writeSocketError(conn, err)
+		return
+	}
+
+	var req SocketSigningRequest
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		writeSocketError(conn, fmt.Errorf("failed to decode signing request: %v", err))
+		return
+	}
+
+	// Authenticating the peer against req.Team (not just a global uid->username mapping) is what stops a uid
+	// entitled to sign for one team from requesting certs against another team's CA and policy
+	username, err := conf.GetKeybaseUsernameForUID(strconv.Itoa(int(uid)), req.Team)
+	if err != nil {
+		writeSocketError(conn, fmt.Errorf("uid %d is not entitled to request certs for team %s: %v", uid, req.Team, err))
+		return
+	}
+
+	cert, err := signPubKey(conf, signingRequest{
+		Team:       req.Team,
+		Username:   username,
+		Principals: req.Principals,
+		PubKey:     req.PubKey,
+	})
+	if err != nil {
+		writeSocketError(conn, err)
+		return
+	}
+
+	_ = json.NewEncoder(conn).Encode(SocketSigningResponse{Cert: string(cert)})
+}
+
+// peerUID uses SO_PEERCRED to determine the uid of the process on the other end of conn
+func peerUID(conn net.Conn) (uint32, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return 0, fmt.Errorf("expected a unix socket connection")
+	}
+
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var cred *unix.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if credErr != nil {
+		return 0, fmt.Errorf("failed to read SO_PEERCRED: %v", credErr)
+	}
+	return cred.Uid, nil
+}
+
+func writeSocketError(conn net.Conn, err error) {
+	_ = json.NewEncoder(conn).Encode(SocketSigningResponse{Error: err.Error()})
+}
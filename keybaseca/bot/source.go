@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/keybase/bot-ssh-ca/keybaseca/config"
+)
+
+// A RequestSource is one way of receiving signing requests (chat, https, slack, ...). Every implementation's
+// Start must route requests through signPubKey so the same policy checks apply regardless of source.
+type RequestSource interface {
+	// Name identifies the source for logging, eg "chat", "https", "slack"
+	Name() string
+	// Start blocks, handling signing requests until it errors out or the process exits
+	Start(conf config.Config) error
+}
+
+// ParseSources parses a comma-separated `--source` flag value (eg "chat,https,slack") into the
+// corresponding RequestSources
+func ParseSources(flag string, conf config.Config) ([]RequestSource, error) {
+	if flag == "" {
+		flag = "chat"
+	}
+
+	var sources []RequestSource
+	for _, name := range strings.Split(flag, ",") {
+		switch strings.TrimSpace(name) {
+		case "chat":
+			listener, err := newChatListener(conf)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, listener)
+		case "https":
+			sources = append(sources, newHTTPSSource(conf))
+		case "slack":
+			slackSource, err := newSlackSource(conf)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, slackSource)
+		case "host":
+			listener, err := newHostChatListener(conf)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, listener)
+		default:
+			return nil, fmt.Errorf("unknown request source %q", name)
+		}
+	}
+	return sources, nil
+}
+
+// StartBot runs every given source concurrently, each handling signing requests until one of them returns a
+// fatal error, at which point StartBot returns that error
+func StartBot(conf config.Config, sources []RequestSource) error {
+	if len(sources) == 0 {
+		return fmt.Errorf("no request sources configured")
+	}
+
+	errs := make(chan error, len(sources))
+	var wg sync.WaitGroup
+	for _, source := range sources {
+		wg.Add(1)
+		go func(source RequestSource) {
+			defer wg.Done()
+			if err := source.Start(conf); err != nil {
+				errs <- fmt.Errorf("%s source crashed: %v", source.Name(), err)
+			}
+		}(source)
+	}
+
+	go func() {
+		wg.Wait()
+		close(errs)
+	}()
+
+	// Return as soon as any single source crashes; the others are left running since a Keybase-chat outage
+	// shouldn't take down the https/slack sources and vice versa, but the operator needs to know
+	for err := range errs {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,312 @@
+// Package config handles loading and validating the server side configuration for keybaseca.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// DefaultConfigLocation is where keybaseca looks for its config file if `--config` is not specified
+const DefaultConfigLocation = "/etc/keybaseca.config"
+
+// AllowAnyPrincipal is the TeamConfig.AllowedPrincipals wildcard entry meaning every principal is allowed.
+// It's what GetTeamConfig's legacy single-CA fallback populates, since that config shape predates
+// AllowedPrincipals and so has no way to express a restricted list.
+const AllowAnyPrincipal = "*"
+
+// TeamConfig describes the policy and CA key that apply to a single team (or "realm")
+type TeamConfig struct {
+	// Where the CA private key for this team lives on disk
+	CAKeyLocation string `json:"ca_key_location"`
+	// The set of SSH principals that this CA is allowed to grant, eg `["ubuntu", "ec2-user"]`
+	AllowedPrincipals []string `json:"allowed_principals"`
+	// The maximum validity (as a flag suitable for ssh-keygen's -V, eg "+8h") that a cert signed for this team
+	// may have
+	MaxCertValidity string `json:"max_cert_validity"`
+	// Source-address extensions embedded in every cert signed for this team, restricting them to only be
+	// presented from these addresses, eg `["10.0.0.0/8"]`. Empty means no source-address restriction.
+	AllowedSourceAddresses []string `json:"allowed_source_addresses,omitempty"`
+	// force-command values embedded in certs signed for this team. Only the first entry is applied, since
+	// ssh-keygen accepts one force-command per cert; the field is a list to allow a future per-request choice.
+	AllowedForceCommands []string `json:"allowed_force_commands,omitempty"`
+	// Encryption describes how CAKeyLocation is encrypted at rest, if at all
+	Encryption EncryptionConfig `json:"encryption,omitempty"`
+	// Host configures host certificate issuance for this team's servers. Omitted/zero-value means this team
+	// does not issue host certs, only user certs.
+	Host HostConfig `json:"host,omitempty"`
+}
+
+// HostConfig configures host certificate issuance for the servers belonging to a team
+type HostConfig struct {
+	// ServersTeam is the Keybase team that a server must belong to in order to have its host key signed, eg
+	// "acme.servers". Membership is how a server proves its identity to the bot.
+	ServersTeam string `json:"servers_team,omitempty"`
+	// CertValidity is how long a signed host cert is valid for (a ssh-keygen -V value, eg "+6h"). Kept short
+	// since host certs are periodically re-signed rather than issued once with a long lifetime.
+	CertValidity string `json:"cert_validity,omitempty"`
+	// RevocationListPath is the KBFS path that the host cert revocation list (a KRL, see ssh-keygen -k) is
+	// published to. sshd consumes it directly via `RevokedKeys`.
+	RevocationListPath string `json:"revocation_list_path,omitempty"`
+}
+
+// EncryptionConfig describes how a CA key is encrypted at rest and how to unwrap it at service start
+type EncryptionConfig struct {
+	// Type is one of "passphrase-prompt", "passphrase-env", "passphrase-file", "kms-aws" or "kms-gcp". Empty
+	// (or "none") means CAKeyLocation is plaintext PEM, as it always was before encryption support existed.
+	Type string `json:"type,omitempty"`
+	// KeySource is interpreted based on Type: a file:// path for "passphrase-file", or a KMS key ARN/resource
+	// name for "kms-aws"/"kms-gcp". Unused for "passphrase-prompt" and "passphrase-env".
+	KeySource string `json:"key_source,omitempty"`
+}
+
+// Config is the interface used by the rest of keybaseca to access the parsed config file
+type Config interface {
+	GetCAKeyLocation() string
+	GetCAKeyLocationForTeam(teamname string) (string, error)
+	GetTeamConfig(teamname string) (TeamConfig, error)
+	GetTeams() []string
+	GetChannelName() string
+	GetKeybaseHomeDir() string
+	GetLogLocation() string
+	GetKeybaseUsernameForUID(uid string, team string) (string, error)
+	GetListenSocketPath() string
+	GetHTTPSListenAddr() string
+	GetHTTPSClientCAPath() string
+	GetHTTPSServerCertPath() string
+	GetHTTPSServerKeyPath() string
+	GetKeybaseUsernameForCommonName(commonName string, team string) (string, error)
+	GetSlackListenAddr() string
+	GetSlackUserMappingPath() string
+	GetSlackSigningSecret() string
+}
+
+type config struct {
+	Teamname       string `json:"teamname,omitempty"`
+	ChannelName    string `json:"channel_name,omitempty"`
+	CAKeyLocation  string `json:"key_path,omitempty"`
+	KeybaseHomeDir string `json:"keybase_home_dir,omitempty"`
+	LogLocation    string `json:"log_location,omitempty"`
+	// Teams maps team name to its per-team policy. If a team is not present here it falls back to the
+	// top level CAKeyLocation with no principal/validity restrictions, for backwards compatibility with
+	// single-CA configs.
+	Teams map[string]TeamConfig `json:"teams,omitempty"`
+	// UIDMapping maps the stringified uid of a local process (as reported by SO_PEERCRED on the unix
+	// signing socket) to the Keybase username that process is allowed to request certs as, and which teams
+	// it's entitled to request them for
+	UIDMapping map[string]IdentityMapping `json:"uid_mapping,omitempty"`
+	// ListenSocketPath, if set, is where the unix signing socket is created. Overridden by --listen-socket.
+	ListenSocketPath string `json:"listen_socket_path,omitempty"`
+	// HTTPS configures the mTLS webhook acquisition source, used when --source includes "https"
+	HTTPS HTTPSSourceConfig `json:"https_source,omitempty"`
+	// Slack configures the Slack slash-command acquisition source, used when --source includes "slack"
+	Slack SlackSourceConfig `json:"slack_source,omitempty"`
+}
+
+// HTTPSSourceConfig configures the mTLS webhook signing source
+type HTTPSSourceConfig struct {
+	ListenAddr       string                     `json:"listen_addr,omitempty"`
+	ClientCAPath     string                     `json:"client_ca_path,omitempty"`
+	ServerCertPath   string                     `json:"server_cert_path,omitempty"`
+	ServerKeyPath    string                     `json:"server_key_path,omitempty"`
+	CommonNameToUser map[string]IdentityMapping `json:"common_name_to_user,omitempty"`
+}
+
+// IdentityMapping binds a caller-supplied identity (a unix socket peer uid, or an mTLS client cert's
+// CommonName) to the Keybase username it's allowed to request certs as, and the teams it may request them
+// for. Scoping Teams per identity is what gives each acquisition source the same cross-team blast-radius
+// isolation that Keybase team membership gives the chat source for free.
+type IdentityMapping struct {
+	Username string   `json:"username"`
+	Teams    []string `json:"teams"`
+}
+
+// entitledForTeam reports whether this mapping grants access to team
+func (m IdentityMapping) entitledForTeam(team string) bool {
+	for _, t := range m.Teams {
+		if t == team {
+			return true
+		}
+	}
+	return false
+}
+
+// SlackSourceConfig configures the Slack slash-command signing source
+type SlackSourceConfig struct {
+	ListenAddr      string `json:"listen_addr,omitempty"`
+	UserMappingPath string `json:"user_mapping_path,omitempty"`
+	// SigningSecret is the Slack app's signing secret, used to verify the X-Slack-Signature header on every
+	// request so that only Slack itself (not anyone who can reach ListenAddr) can trigger a signing request
+	SigningSecret string `json:"signing_secret,omitempty"`
+}
+
+// LoadConfig loads and parses a keybaseca config file from the given location on disk
+func LoadConfig(filename string) (Config, error) {
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil, fmt.Errorf("config file at %s does not exist", filename)
+	}
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	var conf config
+	err = json.Unmarshal(bytes, &conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	}
+	if conf.Teamname == "" {
+		return nil, fmt.Errorf("config file at %s is missing required field teamname", filename)
+	}
+	return &conf, nil
+}
+
+// PersistEncryption writes enc into the static config file at filename as team's Encryption setting. This is
+// required after encrypting a CA key in place (eg `keybaseca generate --encrypt`/`--kms=`): without it, the
+// next process to load the config file from disk still sees Encryption.Type == "" and will try to use the
+// now-ciphertext key as if it were plaintext.
+func PersistEncryption(filename string, team string, enc EncryptionConfig) error {
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	var raw config
+	if err := json.Unmarshal(bytes, &raw); err != nil {
+		return fmt.Errorf("failed to parse config file: %v", err)
+	}
+
+	if tc, ok := raw.Teams[team]; ok {
+		tc.Encryption = enc
+		raw.Teams[team] = tc
+	} else if raw.Teamname == team {
+		// Legacy single-CA config: promote it to a Teams entry, since that's the only place Encryption can
+		// be expressed
+		if raw.Teams == nil {
+			raw.Teams = make(map[string]TeamConfig)
+		}
+		raw.Teams[team] = TeamConfig{
+			CAKeyLocation:     raw.CAKeyLocation,
+			AllowedPrincipals: []string{AllowAnyPrincipal},
+			Encryption:        enc,
+		}
+	} else {
+		return fmt.Errorf("no policy configured for team %s", team)
+	}
+
+	out, err := json.MarshalIndent(&raw, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal updated config: %v", err)
+	}
+	return ioutil.WriteFile(filename, out, 0644)
+}
+
+func (c *config) GetCAKeyLocation() string {
+	return c.CAKeyLocation
+}
+
+// GetCAKeyLocationForTeam returns the CA key location for the given team, falling back to the top level
+// CAKeyLocation if the team does not have its own entry in the Teams map
+func (c *config) GetCAKeyLocationForTeam(teamname string) (string, error) {
+	if tc, ok := c.Teams[teamname]; ok && tc.CAKeyLocation != "" {
+		return tc.CAKeyLocation, nil
+	}
+	if c.CAKeyLocation != "" {
+		return c.CAKeyLocation, nil
+	}
+	return "", fmt.Errorf("no CA key location configured for team %s", teamname)
+}
+
+// GetTeamConfig returns the policy configured for the given team. Returns an error if the team has no
+// per-team policy and there is no way to derive sane defaults for it.
+func (c *config) GetTeamConfig(teamname string) (TeamConfig, error) {
+	if tc, ok := c.Teams[teamname]; ok {
+		return tc, nil
+	}
+	if c.CAKeyLocation != "" {
+		return TeamConfig{CAKeyLocation: c.CAKeyLocation, AllowedPrincipals: []string{AllowAnyPrincipal}}, nil
+	}
+	return TeamConfig{}, fmt.Errorf("no policy configured for team %s", teamname)
+}
+
+func (c *config) GetTeams() []string {
+	if len(c.Teams) > 0 {
+		teams := make([]string, 0, len(c.Teams))
+		for team := range c.Teams {
+			teams = append(teams, team)
+		}
+		return teams
+	}
+	return []string{c.Teamname}
+}
+
+func (c *config) GetChannelName() string {
+	return c.ChannelName
+}
+
+func (c *config) GetKeybaseHomeDir() string {
+	return c.KeybaseHomeDir
+}
+
+func (c *config) GetLogLocation() string {
+	return c.LogLocation
+}
+
+// GetKeybaseUsernameForUID maps the uid of a process connecting to the unix signing socket to the Keybase
+// username it is allowed to request certs as. Returns an error if the uid has no configured mapping, or if
+// its mapping isn't entitled to request certs for team.
+func (c *config) GetKeybaseUsernameForUID(uid string, team string) (string, error) {
+	mapping, ok := c.UIDMapping[uid]
+	if !ok {
+		return "", fmt.Errorf("no uid_mapping entry for uid %s", uid)
+	}
+	if !mapping.entitledForTeam(team) {
+		return "", fmt.Errorf("uid %s is not entitled to request certs for team %s", uid, team)
+	}
+	return mapping.Username, nil
+}
+
+func (c *config) GetListenSocketPath() string {
+	return c.ListenSocketPath
+}
+
+func (c *config) GetHTTPSListenAddr() string {
+	return c.HTTPS.ListenAddr
+}
+
+func (c *config) GetHTTPSClientCAPath() string {
+	return c.HTTPS.ClientCAPath
+}
+
+func (c *config) GetHTTPSServerCertPath() string {
+	return c.HTTPS.ServerCertPath
+}
+
+func (c *config) GetHTTPSServerKeyPath() string {
+	return c.HTTPS.ServerKeyPath
+}
+
+// GetKeybaseUsernameForCommonName maps the CommonName of a verified mTLS client certificate to the Keybase
+// username it is allowed to request certs as. Returns an error if the CommonName has no configured mapping,
+// or if its mapping isn't entitled to request certs for team.
+func (c *config) GetKeybaseUsernameForCommonName(commonName string, team string) (string, error) {
+	mapping, ok := c.HTTPS.CommonNameToUser[commonName]
+	if !ok {
+		return "", fmt.Errorf("no common_name_to_user entry for client certificate CommonName %s", commonName)
+	}
+	if !mapping.entitledForTeam(team) {
+		return "", fmt.Errorf("client certificate CommonName %s is not entitled to request certs for team %s", commonName, team)
+	}
+	return mapping.Username, nil
+}
+
+func (c *config) GetSlackListenAddr() string {
+	return c.Slack.ListenAddr
+}
+
+func (c *config) GetSlackUserMappingPath() string {
+	return c.Slack.UserMappingPath
+}
+
+func (c *config) GetSlackSigningSecret() string {
+	return c.Slack.SigningSecret
+}
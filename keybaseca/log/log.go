@@ -0,0 +1,160 @@
+// Package log implements keybaseca's tamper-evident audit log: one JSON record per line, each record's
+// hash computed over the previous record's hash plus its own contents, so that editing or deleting any past
+// record breaks the chain for every record after it.
+package log
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keybase/bot-ssh-ca/keybaseca/config"
+)
+
+// logMu serializes LogRecord's read-of-head-hash-then-append so that two concurrent signs (eg the unix
+// socket listener's per-connection goroutine, a host cert renewal, and one of the HTTP-based acquisition
+// sources all firing at once) can't both read the same prevHash and append conflicting links in the chain.
+var logMu sync.Mutex
+
+// EventType identifies what kind of thing happened in a Record
+type EventType string
+
+const (
+	EventSignRequest  EventType = "sign_request"
+	EventKeyExport    EventType = "key_export"
+	EventConfigWrite  EventType = "config_write"
+	EventConfigDelete EventType = "config_delete"
+	EventBotStart     EventType = "bot_start"
+	EventBotStop      EventType = "bot_stop"
+)
+
+// Record is a single entry in the audit log
+type Record struct {
+	Timestamp           time.Time `json:"timestamp"`
+	EventType           EventType `json:"event_type"`
+	Message             string    `json:"message,omitempty"`
+	ActorUsername       string    `json:"actor_username,omitempty"`
+	Team                string    `json:"team,omitempty"`
+	RequestedPrincipals []string  `json:"requested_principals,omitempty"`
+	GrantedPrincipals   []string  `json:"granted_principals,omitempty"`
+	CertSerial          string    `json:"cert_serial,omitempty"`
+	CertValidityWindow  string    `json:"cert_validity_window,omitempty"`
+	PrevHash            string    `json:"prev_hash"`
+	Hash                string    `json:"hash"`
+}
+
+// Log appends a structured, hash-chained record to the audit log configured in conf
+func Log(conf config.Config, eventType EventType, message string) error {
+	return LogRecord(conf, Record{
+		Timestamp: time.Now(),
+		EventType: eventType,
+		Message:   message,
+	})
+}
+
+// LogRecord appends rec to the audit log, filling in its Timestamp (if zero), PrevHash and Hash. Safe to call
+// concurrently from multiple goroutines: the read-head-hash-then-append sequence is serialized so that two
+// concurrent calls always see a consistent, unbroken chain rather than racing to extend the same prevHash.
+func LogRecord(conf config.Config, rec Record) error {
+	logMu.Lock()
+	defer logMu.Unlock()
+
+	if rec.Timestamp.IsZero() {
+		rec.Timestamp = time.Now()
+	}
+
+	prevHash, err := headHash(conf.GetLogLocation())
+	if err != nil {
+		return err
+	}
+	rec.PrevHash = prevHash
+	rec.Hash = hashRecord(rec)
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(conf.GetLogLocation(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log at %s: %v", conf.GetLogLocation(), err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// hashRecord computes the chained hash of rec: sha256(prevHash || json of rec with Hash cleared)
+func hashRecord(rec Record) string {
+	rec.Hash = ""
+	bytes, _ := json.Marshal(rec)
+	sum := sha256.Sum256(append([]byte(rec.PrevHash), bytes...))
+	return hex.EncodeToString(sum[:])
+}
+
+// headHash returns the Hash of the last record in the audit log, or "" if the log doesn't exist yet
+func headHash(logLocation string) (string, error) {
+	if _, err := os.Stat(logLocation); os.IsNotExist(err) {
+		return "", nil
+	}
+
+	bytes, err := ioutil.ReadFile(logLocation)
+	if err != nil {
+		return "", fmt.Errorf("failed to read audit log at %s: %v", logLocation, err)
+	}
+
+	var lastHash string
+	scanner := bufio.NewScanner(strings.NewReader(string(bytes)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return "", fmt.Errorf("failed to parse audit log line: %v", err)
+		}
+		lastHash = rec.Hash
+	}
+	return lastHash, scanner.Err()
+}
+
+// Verify walks every record in the audit log and confirms its Hash matches what LogRecord would have
+// computed given the preceding record's hash. Returns the zero-indexed line number of the first broken
+// link, or -1 if the whole chain is intact.
+func Verify(logLocation string) (brokenAt int, err error) {
+	bytes, err := ioutil.ReadFile(logLocation)
+	if err != nil {
+		return -1, fmt.Errorf("failed to read audit log at %s: %v", logLocation, err)
+	}
+
+	prevHash := ""
+	scanner := bufio.NewScanner(strings.NewReader(string(bytes)))
+	for i := 0; scanner.Scan(); i++ {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return i, fmt.Errorf("failed to parse audit log line %d: %v", i, err)
+		}
+		if rec.PrevHash != prevHash {
+			return i, nil
+		}
+		expectedHash := hashRecord(rec)
+		if rec.Hash != expectedHash {
+			return i, nil
+		}
+		prevHash = rec.Hash
+	}
+	return -1, scanner.Err()
+}
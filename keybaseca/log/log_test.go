@@ -0,0 +1,77 @@
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/keybase/bot-ssh-ca/keybaseca/config"
+)
+
+// fakeConfig is a minimal config.Config for tests that only need GetLogLocation
+type fakeConfig struct {
+	logLocation string
+}
+
+func (f *fakeConfig) GetCAKeyLocation() string                       { return "" }
+func (f *fakeConfig) GetCAKeyLocationForTeam(string) (string, error) { return "", nil }
+func (f *fakeConfig) GetTeamConfig(string) (config.TeamConfig, error) {
+	return config.TeamConfig{}, nil
+}
+func (f *fakeConfig) GetTeams() []string                                      { return nil }
+func (f *fakeConfig) GetChannelName() string                                  { return "" }
+func (f *fakeConfig) GetKeybaseHomeDir() string                               { return "" }
+func (f *fakeConfig) GetLogLocation() string                                  { return f.logLocation }
+func (f *fakeConfig) GetKeybaseUsernameForUID(string, string) (string, error) { return "", nil }
+func (f *fakeConfig) GetListenSocketPath() string                             { return "" }
+func (f *fakeConfig) GetHTTPSListenAddr() string                              { return "" }
+func (f *fakeConfig) GetHTTPSClientCAPath() string                            { return "" }
+func (f *fakeConfig) GetHTTPSServerCertPath() string                          { return "" }
+func (f *fakeConfig) GetHTTPSServerKeyPath() string                           { return "" }
+func (f *fakeConfig) GetKeybaseUsernameForCommonName(string, string) (string, error) {
+	return "", nil
+}
+func (f *fakeConfig) GetSlackListenAddr() string      { return "" }
+func (f *fakeConfig) GetSlackUserMappingPath() string { return "" }
+func (f *fakeConfig) GetSlackSigningSecret() string   { return "" }
+
+func TestVerifyDetectsTamperedRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keybaseca-log-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logLocation := dir + "/audit.log"
+	conf := &fakeConfig{logLocation: logLocation}
+
+	for _, msg := range []string{"first", "second", "third"} {
+		if err := Log(conf, EventBotStart, msg); err != nil {
+			t.Fatalf("failed to log %q: %v", msg, err)
+		}
+	}
+
+	if brokenAt, err := Verify(logLocation); err != nil || brokenAt != -1 {
+		t.Fatalf("expected an untampered log to verify clean, got brokenAt=%d err=%v", brokenAt, err)
+	}
+
+	bytes, err := ioutil.ReadFile(logLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Swap in a same-length replacement for the last record's message so the line stays valid JSON but its
+	// hash no longer matches what LogRecord computed
+	contents := strings.Replace(string(bytes), "third", "THIRD", 1)
+	if err := ioutil.WriteFile(logLocation, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	brokenAt, err := Verify(logLocation)
+	if err != nil {
+		t.Fatalf("unexpected error verifying tampered log: %v", err)
+	}
+	if brokenAt != 2 {
+		t.Fatalf("expected tampering in the last line (index 2) to be detected, got brokenAt=%d", brokenAt)
+	}
+}
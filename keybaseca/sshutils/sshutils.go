@@ -0,0 +1,88 @@
+// Package sshutils wraps calls to ssh-keygen used to generate and inspect CA keys.
+package sshutils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/keybase/bot-ssh-ca/keybaseca/config"
+)
+
+// Generate generates a new CA keypair for every team configured in conf. If overwrite is false, Generate
+// refuses to clobber a key that already exists on disk for a given team. If printPubKey is true, the
+// generated public key (and its fingerprint) are printed to stdout for each team.
+func Generate(conf config.Config, overwrite bool, printPubKey bool) error {
+	for _, team := range conf.GetTeams() {
+		keyLocation, err := conf.GetCAKeyLocationForTeam(team)
+		if err != nil {
+			return err
+		}
+
+		if _, err := os.Stat(keyLocation); err == nil && !overwrite {
+			return fmt.Errorf("CA key for team %s already exists at %s, pass --overwrite-existing-key to replace it", team, keyLocation)
+		}
+
+		err = os.Remove(keyLocation)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		cmd := exec.Command("ssh-keygen", "-t", "ed25519", "-f", keyLocation, "-N", "", "-C", fmt.Sprintf("keybaseca CA key for %s", team))
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to generate CA key for team %s: %v: %s", team, err, string(output))
+		}
+
+		if printPubKey {
+			fingerprint, err := GetCAKeyFingerprint(conf, team)
+			if err != nil {
+				return err
+			}
+			pubKey, err := GetCAPublicKey(conf, team)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Generated new CA key for team %s (fingerprint %s):\n%s\n", team, fingerprint, pubKey)
+		}
+	}
+	return nil
+}
+
+// GetCAKeyFingerprint returns the fingerprint (as printed by `ssh-keygen -lf`) of the public half of the
+// given team's CA key. kssh uses this to pin/verify which CA it expects to be talking to for a team.
+func GetCAKeyFingerprint(conf config.Config, team string) (string, error) {
+	keyLocation, err := conf.GetCAKeyLocationForTeam(team)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command("ssh-keygen", "-lf", keyLocation+".pub")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to get fingerprint of CA key for team %s: %v: %s", team, err, string(output))
+	}
+
+	// Output looks like: "256 SHA256:abc123... keybaseca CA key for team (ED25519)"
+	fields := strings.Fields(string(output))
+	if len(fields) < 2 {
+		return "", fmt.Errorf("unexpected ssh-keygen output when fingerprinting CA key for team %s: %s", team, string(output))
+	}
+	return fields[1], nil
+}
+
+// GetCAPublicKey returns the public half (in authorized_keys format) of the given team's CA key
+func GetCAPublicKey(conf config.Config, team string) (string, error) {
+	keyLocation, err := conf.GetCAKeyLocationForTeam(team)
+	if err != nil {
+		return "", err
+	}
+
+	bytes, err := ioutil.ReadFile(keyLocation + ".pub")
+	if err != nil {
+		return "", fmt.Errorf("failed to read public key for team %s: %v", team, err)
+	}
+	return strings.TrimSpace(string(bytes)), nil
+}
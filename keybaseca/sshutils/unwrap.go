@@ -0,0 +1,150 @@
+package sshutils
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/keybase/bot-ssh-ca/keybaseca/config"
+)
+
+// A KeyUnwrapper knows how to turn the encrypted on-disk representation of a CA key into the plaintext PEM
+// key. Implementations range from "ask the operator for a passphrase" to calling out to a cloud KMS.
+type KeyUnwrapper interface {
+	Unwrap(ctx context.Context, ciphertext []byte) ([]byte, error)
+}
+
+// NewUnwrapper builds the KeyUnwrapper configured for the given team's CA key. Supported encryption.type
+// values are "passphrase-prompt", "passphrase-env", "passphrase-file", "kms-aws" and "kms-gcp".
+func NewUnwrapper(teamConfig config.TeamConfig) (KeyUnwrapper, error) {
+	switch teamConfig.Encryption.Type {
+	case "", "none":
+		return nil, nil
+	case "passphrase-prompt":
+		return &passphraseUnwrapper{source: promptForPassphrase}, nil
+	case "passphrase-env":
+		return &passphraseUnwrapper{source: func() ([]byte, error) {
+			passphrase := os.Getenv("KEYBASECA_PASSPHRASE")
+			if passphrase == "" {
+				return nil, fmt.Errorf("KEYBASECA_PASSPHRASE is not set")
+			}
+			return []byte(passphrase), nil
+		}}, nil
+	case "passphrase-file":
+		return &passphraseUnwrapper{source: func() ([]byte, error) {
+			path := strings.TrimPrefix(teamConfig.Encryption.KeySource, "file://")
+			bytes, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read passphrase file %s: %v", path, err)
+			}
+			return []byte(strings.TrimSpace(string(bytes))), nil
+		}}, nil
+	case "kms-aws":
+		return newAWSKMSUnwrapper(teamConfig.Encryption.KeySource)
+	case "kms-gcp":
+		return newGCPKMSUnwrapper(teamConfig.Encryption.KeySource)
+	default:
+		return nil, fmt.Errorf("unknown encryption.type %q", teamConfig.Encryption.Type)
+	}
+}
+
+// passphraseUnwrapper decrypts an OpenSSH-encrypted-PEM CA key (as produced by `ssh-keygen -N passphrase`)
+// using a passphrase obtained from source
+type passphraseUnwrapper struct {
+	source func() ([]byte, error)
+}
+
+func (p *passphraseUnwrapper) Unwrap(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	passphrase, err := p.source()
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain passphrase: %v", err)
+	}
+	key, err := ssh.ParseRawPrivateKeyWithPassphrase(ciphertext, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt CA key: %v", err)
+	}
+	return marshalUnencryptedPrivateKey(key)
+}
+
+func promptForPassphrase() ([]byte, error) {
+	fmt.Print("Enter passphrase for CA key: ")
+	var passphrase string
+	_, err := fmt.Scanln(&passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(passphrase), nil
+}
+
+// marshalUnencryptedPrivateKey re-encodes a decrypted key (as returned by ssh.ParseRawPrivateKeyWithPassphrase)
+// back into a plain, unencrypted PEM block
+func marshalUnencryptedPrivateKey(key interface{}) ([]byte, error) {
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to re-marshal decrypted CA key: %v", err)
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// LoadCAKey reads the (possibly encrypted) CA private key for teamConfig off disk, unwrapping it if
+// teamConfig.Encryption is configured, and returns the plaintext PEM bytes ready to hand to ssh-keygen.
+func LoadCAKey(ctx context.Context, teamConfig config.TeamConfig) ([]byte, error) {
+	ciphertext, err := ioutil.ReadFile(teamConfig.CAKeyLocation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA key from %s: %v", teamConfig.CAKeyLocation, err)
+	}
+
+	unwrapper, err := NewUnwrapper(teamConfig)
+	if err != nil {
+		return nil, err
+	}
+	if unwrapper == nil {
+		return ciphertext, nil
+	}
+	return unwrapper.Unwrap(ctx, ciphertext)
+}
+
+// PrepareSigningKey returns a path to a plaintext copy of teamConfig's CA key, suitable for passing to
+// `ssh-keygen -s`. If the key isn't encrypted at rest, that's just teamConfig.CAKeyLocation itself. If it
+// is, PrepareSigningKey unwraps it (prompting/reading the passphrase or calling out to KMS, as configured)
+// and writes the plaintext to a 0600 temp file so that ssh-keygen never has to prompt for a passphrase
+// itself against the bot's non-interactive stdin. The caller must invoke the returned cleanup func once
+// done signing so the plaintext copy doesn't linger on disk.
+func PrepareSigningKey(ctx context.Context, teamConfig config.TeamConfig) (path string, cleanup func(), err error) {
+	if teamConfig.Encryption.Type == "" || teamConfig.Encryption.Type == "none" {
+		return teamConfig.CAKeyLocation, func() {}, nil
+	}
+
+	plaintext, err := LoadCAKey(ctx, teamConfig)
+	if err != nil {
+		return "", nil, err
+	}
+
+	f, err := ioutil.TempFile("", "keybaseca-ca-key-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.Remove(f.Name()) }
+
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		cleanup()
+		return "", nil, err
+	}
+	if _, err := f.Write(plaintext); err != nil {
+		f.Close()
+		cleanup()
+		return "", nil, err
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	return f.Name(), cleanup, nil
+}
@@ -0,0 +1,62 @@
+package sshutils
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+
+	"github.com/keybase/bot-ssh-ca/keybaseca/config"
+)
+
+// EncryptCAKeyInPlace encrypts the plaintext CA key at keyLocation according to teamConfig.Encryption. Used
+// by `generate --encrypt`/`--kms=` right after a fresh key is written.
+func EncryptCAKeyInPlace(ctx context.Context, teamConfig config.TeamConfig, keyLocation string) error {
+	switch teamConfig.Encryption.Type {
+	case "", "none":
+		return fmt.Errorf("no encryption.type configured for this team, refusing to silently store the key in plaintext")
+	case "passphrase-prompt", "passphrase-env", "passphrase-file":
+		unwrapper, err := NewUnwrapper(teamConfig)
+		if err != nil {
+			return err
+		}
+		passphraseUnwrapper, ok := unwrapper.(*passphraseUnwrapper)
+		if !ok {
+			return fmt.Errorf("internal error: expected a passphrase unwrapper for encryption.type %s", teamConfig.Encryption.Type)
+		}
+		passphrase, err := passphraseUnwrapper.source()
+		if err != nil {
+			return err
+		}
+		cmd := exec.Command("ssh-keygen", "-p", "-f", keyLocation, "-N", string(passphrase))
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to encrypt CA key: %v: %s", err, string(output))
+		}
+		return nil
+	case "kms-aws", "kms-gcp":
+		return encryptWithKMS(ctx, teamConfig, keyLocation)
+	default:
+		return fmt.Errorf("unknown encryption.type %q", teamConfig.Encryption.Type)
+	}
+}
+
+func encryptWithKMS(ctx context.Context, teamConfig config.TeamConfig, keyLocation string) error {
+	plaintext, err := ioutil.ReadFile(keyLocation)
+	if err != nil {
+		return fmt.Errorf("failed to read plaintext CA key: %v", err)
+	}
+
+	var ciphertext []byte
+	switch teamConfig.Encryption.Type {
+	case "kms-aws":
+		ciphertext, err = awsKMSEncrypt(ctx, teamConfig.Encryption.KeySource, plaintext)
+	case "kms-gcp":
+		ciphertext, err = gcpKMSEncrypt(ctx, teamConfig.Encryption.KeySource, plaintext)
+	}
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(keyLocation, ciphertext, 0600)
+}
@@ -15,6 +15,28 @@ type ConfigFile struct {
 	TeamName    string `json:"teamname"`
 	ChannelName string `json:"channelname"`
 	BotName     string `json:"botname"`
+	// CAFingerprint is the fingerprint (as printed by `ssh-keygen -lf`) of the CA key that signs certs for
+	// TeamName. kssh pins against this so that a bot compromised for one team can't silently start signing
+	// with a different team's CA.
+	CAFingerprint string `json:"ca_fingerprint,omitempty"`
+	// HostCAPublicKey is the public half of TeamName's CA key, in authorized_keys format, present only for
+	// teams that issue host certs. kssh --install-known-hosts writes this into ~/.ssh/known_hosts as a
+	// @cert-authority line so that users get TOFU-free host verification for this team's servers.
+	HostCAPublicKey string `json:"host_ca_public_key,omitempty"`
+}
+
+// VerifyCAFingerprint checks that the fingerprint presented by a signing response for this config's team
+// matches the fingerprint that was pinned in the client config. Returns an error if they don't match, which
+// callers should treat as a signal to abort rather than install the resulting cert.
+func (cf ConfigFile) VerifyCAFingerprint(presented string) error {
+	if cf.CAFingerprint == "" {
+		// Older client configs (or teams running a single global CA) may not have a pinned fingerprint yet
+		return nil
+	}
+	if presented != cf.CAFingerprint {
+		return fmt.Errorf("CA fingerprint mismatch for team %s: expected %s, got %s", cf.TeamName, cf.CAFingerprint, presented)
+	}
+	return nil
 }
 
 // LoadConfigs loads client configs from KBFS. Returns a (listOfConfigFiles, listOfTeamNames, err)
@@ -0,0 +1,54 @@
+package kssh
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/keybase/bot-ssh-ca/shared"
+)
+
+var knownHostsLocation = shared.ExpandPathWithTilde("~/.ssh/known_hosts")
+
+// InstallKnownHosts writes a `@cert-authority` entry for cf's team into ~/.ssh/known_hosts, scoped to
+// hostPattern (eg "*.example.com"), so that sshd-verified host certs for that team are trusted without ever
+// needing to TOFU a host key. Returns an error if cf's team doesn't issue host certs, and is idempotent if
+// the entry is already present.
+func InstallKnownHosts(cf ConfigFile, hostPattern string) error {
+	if cf.HostCAPublicKey == "" {
+		return fmt.Errorf("team %s is not configured to issue host certs", cf.TeamName)
+	}
+
+	entry := fmt.Sprintf("@cert-authority %s %s", hostPattern, cf.HostCAPublicKey)
+
+	existing, err := readKnownHosts()
+	if err != nil {
+		return err
+	}
+	for _, line := range existing {
+		if strings.TrimSpace(line) == entry {
+			return nil
+		}
+	}
+
+	f, err := os.OpenFile(knownHostsLocation, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", knownHostsLocation, err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(entry + "\n")
+	return err
+}
+
+func readKnownHosts() ([]string, error) {
+	if _, err := os.Stat(knownHostsLocation); os.IsNotExist(err) {
+		return nil, nil
+	}
+	bytes, err := ioutil.ReadFile(knownHostsLocation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", knownHostsLocation, err)
+	}
+	return strings.Split(string(bytes), "\n"), nil
+}
@@ -0,0 +1,68 @@
+package kssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// A Signer knows how to turn a pubkey into a signed cert for a given team. UnixSocketSigner, the only
+// implementation in kssh, talks directly to a co-located keybaseca process over a UNIX socket, skipping
+// chat/KBFS entirely; there is no Signer that routes the request through Keybase chat.
+type Signer interface {
+	Sign(team string, principals []string, validity string, pubKey string) (cert string, err error)
+}
+
+// unixSocketSigningRequest/unixSocketSigningResponse mirror keybaseca/bot.SocketSigningRequest/Response
+type unixSocketSigningRequest struct {
+	Team       string   `json:"team"`
+	Principals []string `json:"principals"`
+	Validity   string   `json:"validity"`
+	PubKey     string   `json:"pub_key"`
+}
+
+type unixSocketSigningResponse struct {
+	Cert  string `json:"cert,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// UnixSocketSigner signs requests by sending them to a keybaseca process listening on a local UNIX socket
+// (keybaseca service --listen-socket=...)
+type UnixSocketSigner struct {
+	SocketPath string
+}
+
+// ParseSignerFlag parses a `--signer=` flag value, eg "unix:///run/keybaseca/kssh.sock", into a Signer. A
+// nil Signer with a nil error means the flag was empty and no Signer was selected.
+func ParseSignerFlag(flag string) (Signer, error) {
+	if flag == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(flag, "unix://") {
+		return nil, fmt.Errorf("unsupported --signer scheme in %q, only unix:// is supported", flag)
+	}
+	return &UnixSocketSigner{SocketPath: strings.TrimPrefix(flag, "unix://")}, nil
+}
+
+func (s *UnixSocketSigner) Sign(team string, principals []string, validity string, pubKey string) (string, error) {
+	conn, err := net.Dial("unix", s.SocketPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to %s: %v", s.SocketPath, err)
+	}
+	defer conn.Close()
+
+	req := unixSocketSigningRequest{Team: team, Principals: principals, Validity: validity, PubKey: pubKey}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return "", err
+	}
+
+	var resp unixSocketSigningResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return "", fmt.Errorf("failed to decode signing response: %v", err)
+	}
+	if resp.Error != "" {
+		return "", fmt.Errorf("signing request rejected: %s", resp.Error)
+	}
+	return resp.Cert, nil
+}
@@ -0,0 +1,96 @@
+// Package shared contains small helpers used by both keybaseca and kssh: wrappers around the `keybase fs`
+// CLI for reading/writing KBFS, and path helpers.
+package shared
+
+import (
+	"fmt"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigFilename is the name of the kssh client config file that keybaseca writes into each team's KBFS
+// directory
+const ConfigFilename = "kssh-client.config"
+
+// KBFSWrite writes content to the given KBFS path, creating parent directories as needed. If overwrite is
+// false and the file already exists, KBFSWrite returns an error instead of clobbering it.
+func KBFSWrite(filename string, content string, overwrite bool) error {
+	if !overwrite {
+		exists, err := KBFSFileExists(filename)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("refusing to overwrite existing KBFS file at %s", filename)
+		}
+	}
+
+	cmd := exec.Command("keybase", "fs", "write", filename)
+	cmd.Stdin = strings.NewReader(content)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v: %s", filename, err, string(output))
+	}
+	return nil
+}
+
+// KBFSRead reads the contents of the given KBFS path
+func KBFSRead(filename string) ([]byte, error) {
+	cmd := exec.Command("keybase", "fs", "read", filename)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", filename, err)
+	}
+	return output, nil
+}
+
+// KBFSDelete deletes the file at the given KBFS path
+func KBFSDelete(filename string) error {
+	cmd := exec.Command("keybase", "fs", "rm", filename)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %v: %s", filename, err, string(output))
+	}
+	return nil
+}
+
+// KBFSFileExists returns whether the given KBFS path exists
+func KBFSFileExists(filename string) (bool, error) {
+	cmd := exec.Command("keybase", "fs", "stat", filename)
+	err := cmd.Run()
+	if err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+// KBFSList lists the directory entries at the given KBFS path, eg the team names under /keybase/team/
+func KBFSList(path string) ([]string, error) {
+	cmd := exec.Command("keybase", "fs", "ls", "-1", path)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", path, err)
+	}
+	var entries []string
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			entries = append(entries, strings.TrimSuffix(line, "/"))
+		}
+	}
+	return entries, nil
+}
+
+// ExpandPathWithTilde expands a leading "~" in path to the current user's home directory
+func ExpandPathWithTilde(path string) string {
+	if !strings.HasPrefix(path, "~") {
+		return path
+	}
+	usr, err := user.Current()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(usr.HomeDir, strings.TrimPrefix(path, "~"))
+}